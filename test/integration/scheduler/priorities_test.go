@@ -26,6 +26,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/kubernetes/pkg/scheduler"
 	schedulerconfig "k8s.io/kubernetes/pkg/scheduler/apis/config"
 	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/imagelocality"
@@ -39,14 +40,20 @@ import (
 
 // This file tests the scheduler priority functions.
 
-func initTestSchedulerForPriorityTest(t *testing.T, scorePluginName string) *testutils.TestContext {
+// initTestSchedulerForPriorityTest starts a scheduler whose only enabled
+// score plugins are scorePlugins, each with its given weight; every other
+// score plugin is disabled. Passing more than one entry allows tests to
+// exercise how several priorities interact, instead of scoring in isolation.
+func initTestSchedulerForPriorityTest(t *testing.T, scorePlugins ...schedulerconfig.Plugin) *testutils.TestContext {
+	var names []string
+	for _, p := range scorePlugins {
+		names = append(names, strings.ToLower(p.Name))
+	}
 	prof := schedulerconfig.KubeSchedulerProfile{
 		SchedulerName: v1.DefaultSchedulerName,
 		Plugins: &schedulerconfig.Plugins{
 			Score: &schedulerconfig.PluginSet{
-				Enabled: []schedulerconfig.Plugin{
-					{Name: scorePluginName, Weight: 1},
-				},
+				Enabled: scorePlugins,
 				Disabled: []schedulerconfig.Plugin{
 					{Name: "*"},
 				},
@@ -55,7 +62,7 @@ func initTestSchedulerForPriorityTest(t *testing.T, scorePluginName string) *tes
 	}
 	testCtx := testutils.InitTestSchedulerWithOptions(
 		t,
-		testutils.InitTestMaster(t, strings.ToLower(scorePluginName), nil),
+		testutils.InitTestMaster(t, strings.Join(names, "-"), nil),
 		false,
 		nil,
 		0,
@@ -69,7 +76,7 @@ func initTestSchedulerForPriorityTest(t *testing.T, scorePluginName string) *tes
 // TestNodeAffinity verifies that scheduler's node affinity priority function
 // works correctly.s
 func TestNodeAffinity(t *testing.T) {
-	testCtx := initTestSchedulerForPriorityTest(t, nodeaffinity.Name)
+	testCtx := initTestSchedulerForPriorityTest(t, schedulerconfig.Plugin{Name: nodeaffinity.Name, Weight: 1})
 	defer testutils.CleanupTest(t, testCtx)
 	// Add a few nodes.
 	_, err := createNodes(testCtx.ClientSet, "testnode", st.MakeNode(), 4)
@@ -121,7 +128,7 @@ func TestNodeAffinity(t *testing.T) {
 // TestPodAffinity verifies that scheduler's pod affinity priority function
 // works correctly.
 func TestPodAffinity(t *testing.T) {
-	testCtx := initTestSchedulerForPriorityTest(t, interpodaffinity.Name)
+	testCtx := initTestSchedulerForPriorityTest(t, schedulerconfig.Plugin{Name: interpodaffinity.Name, Weight: 1})
 	defer testutils.CleanupTest(t, testCtx)
 	// Add a few nodes.
 	topologyKey := "node-topologykey"
@@ -199,7 +206,7 @@ func TestPodAffinity(t *testing.T) {
 // TestImageLocality verifies that the scheduler's image locality priority function
 // works correctly, i.e., the pod gets scheduled to the node where its container images are ready.
 func TestImageLocality(t *testing.T) {
-	testCtx := initTestSchedulerForPriorityTest(t, imagelocality.Name)
+	testCtx := initTestSchedulerForPriorityTest(t, schedulerconfig.Plugin{Name: imagelocality.Name, Weight: 1})
 	defer testutils.CleanupTest(t, testCtx)
 
 	// Create a node with the large image.
@@ -257,7 +264,7 @@ func makeContainersWithImages(images []string) []v1.Container {
 
 // TestEvenPodsSpreadPriority verifies that EvenPodsSpread priority functions well.
 func TestEvenPodsSpreadPriority(t *testing.T) {
-	testCtx := initTestSchedulerForPriorityTest(t, podtopologyspread.Name)
+	testCtx := initTestSchedulerForPriorityTest(t, schedulerconfig.Plugin{Name: podtopologyspread.Name, Weight: 1})
 	defer testutils.CleanupTest(t, testCtx)
 	cs := testCtx.ClientSet
 	ns := testCtx.NS.Name
@@ -362,3 +369,128 @@ func TestEvenPodsSpreadPriority(t *testing.T) {
 		})
 	}
 }
+
+// setupMultiPriorityNodes creates two nodes for TestMultipleScorePlugins:
+// "node-image", which already has imageName cached, and "node-preferred",
+// which carries the node affinity label and is the less-loaded node for
+// pod topology spread purposes. It returns the two nodes in that order.
+func setupMultiPriorityNodes(t *testing.T, cs clientset.Interface, ns string, imageName, labelKey, labelValue string) (imageNode, preferredNode *v1.Node) {
+	var err error
+	imageNode, err = createNode(cs, st.MakeNode().Name("node-image").Label("node", "node-image").
+		Images(map[string]int64{imageName: 3000 * 1024 * 1024}).Obj())
+	if err != nil {
+		t.Fatalf("Cannot create node-image: %v", err)
+	}
+	preferredNode, err = createNode(cs, st.MakeNode().Name("node-preferred").Label("node", "node-preferred").
+		Label(labelKey, labelValue).Obj())
+	if err != nil {
+		t.Fatalf("Cannot create node-preferred: %v", err)
+	}
+
+	// Crowd node-image with pods sharing the incoming pod's spread label, so
+	// that PodTopologySpread favors node-preferred, which has none.
+	for i := 0; i < 3; i++ {
+		existingPod := st.MakePod().Namespace(ns).Name(fmt.Sprintf("crowd-%d", i)).Node(imageNode.Name).
+			Label("foo", "").Container(imageutils.GetPauseImageName()).Obj()
+		createdPod, err := cs.CoreV1().Pods(ns).Create(context.TODO(), existingPod, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Cannot create existing pod %v: %v", existingPod.Name, err)
+		}
+		if err := wait.Poll(pollInterval, wait.ForeverTestTimeout, testutils.PodScheduled(cs, createdPod.Namespace, createdPod.Name)); err != nil {
+			t.Fatalf("Existing pod %v did not schedule: %v", existingPod.Name, err)
+		}
+	}
+	return imageNode, preferredNode
+}
+
+// newMultiPriorityPod builds the incoming pod for TestMultipleScorePlugins: it
+// carries the cached image (favoring node-image under ImageLocality), a
+// node affinity preference and a node-level spread constraint (both favoring
+// node-preferred), so the three score plugins disagree about where to land it.
+func newMultiPriorityPod(ns, imageName, labelKey, labelValue string) *v1.Pod {
+	pod := st.MakePod().Namespace(ns).Name("multi-priority-pod").Label("foo", "").
+		Container(imageName).
+		SpreadConstraint(1, "node", softSpread, st.MakeLabelSelector().Exists("foo").Obj()).
+		Obj()
+	pod.Spec.Affinity = &v1.Affinity{
+		NodeAffinity: &v1.NodeAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.PreferredSchedulingTerm{
+				{
+					Preference: v1.NodeSelectorTerm{
+						MatchExpressions: []v1.NodeSelectorRequirement{
+							{
+								Key:      labelKey,
+								Operator: v1.NodeSelectorOpIn,
+								Values:   []string{labelValue},
+							},
+						},
+					},
+					Weight: 50,
+				},
+			},
+		},
+	}
+	return pod
+}
+
+// TestMultipleScorePlugins verifies that when several score plugins disagree
+// about the preferred node, the scheduler's ranking is a deterministic
+// function of each plugin's configured weight: whichever side of the
+// disagreement carries the larger combined weight wins.
+func TestMultipleScorePlugins(t *testing.T) {
+	const (
+		imageName  = "fake-large-image:v1"
+		labelKey   = "kubernetes.io/node-topologyKey"
+		labelValue = "topologyvalue"
+	)
+
+	tests := []struct {
+		name         string
+		scorePlugins []schedulerconfig.Plugin
+		want         string
+	}{
+		{
+			// ImageLocality's weight dominates NodeAffinity's and
+			// PodTopologySpread's combined weight, so the pod follows the image.
+			name: "ImageLocality outweighs NodeAffinity and PodTopologySpread",
+			scorePlugins: []schedulerconfig.Plugin{
+				{Name: imagelocality.Name, Weight: 10},
+				{Name: nodeaffinity.Name, Weight: 1},
+				{Name: podtopologyspread.Name, Weight: 1},
+			},
+			want: "node-image",
+		},
+		{
+			// NodeAffinity and PodTopologySpread together outweigh
+			// ImageLocality, so the pod follows the label and the spread.
+			name: "NodeAffinity and PodTopologySpread outweigh ImageLocality",
+			scorePlugins: []schedulerconfig.Plugin{
+				{Name: imagelocality.Name, Weight: 1},
+				{Name: nodeaffinity.Name, Weight: 5},
+				{Name: podtopologyspread.Name, Weight: 5},
+			},
+			want: "node-preferred",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testCtx := initTestSchedulerForPriorityTest(t, tt.scorePlugins...)
+			defer testutils.CleanupTest(t, testCtx)
+			cs := testCtx.ClientSet
+			ns := testCtx.NS.Name
+
+			setupMultiPriorityNodes(t, cs, ns, imageName, labelKey, labelValue)
+
+			pod := newMultiPriorityPod(ns, imageName, labelKey, labelValue)
+			createdPod, err := cs.CoreV1().Pods(ns).Create(context.TODO(), pod, metav1.CreateOptions{})
+			if err != nil {
+				t.Fatalf("Error creating pod: %v", err)
+			}
+			err = wait.Poll(pollInterval, wait.ForeverTestTimeout, podScheduledIn(cs, createdPod.Namespace, createdPod.Name, []string{tt.want}))
+			if err != nil {
+				t.Errorf("Pod %v was not scheduled on the expected node %v: %v", createdPod.Name, tt.want, err)
+			}
+		})
+	}
+}